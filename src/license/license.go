@@ -0,0 +1,171 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package license does best-effort SPDX license identification against
+// a small vendored table of license templates, so that `drive stat` can
+// report what a LICENSE/COPYING/NOTICE file in a Drive-hosted tree
+// probably is without the caller having to download and eyeball it.
+package license
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Unknown is reported when nothing in the table clears Threshold.
+const Unknown = "UNKNOWN"
+
+// Threshold is the minimum similarity score, in [0, 1], required before
+// a match is trusted rather than reported as Unknown.
+const Threshold = 0.85
+
+// templates is a small vendored table of normalized SPDX license
+// bodies. It is intentionally not exhaustive -- it covers the licenses
+// most commonly vendored alongside source trees -- and normalize()
+// lowercases the candidate and strips line-leading comment markers,
+// punctuation and extra whitespace so that an otherwise-verbatim copy
+// scores close to its template. Copyright years and holder names are
+// not removed; they remain as extra tokens in the candidate.
+var templates = map[string]string{
+	"MIT": `permission is hereby granted free of charge to any person obtaining a copy
+of this software and associated documentation files the software to deal
+in the software without restriction including without limitation the rights
+to use copy modify merge publish distribute sublicense and or sell
+copies of the software and to permit persons to whom the software is
+furnished to do so subject to the following conditions
+the above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the software
+the software is provided as is without warranty of any kind express or
+implied including but not limited to the warranties of merchantability
+fitness for a particular purpose and noninfringement in no event shall the
+authors or copyright holders be liable for any claim damages or other
+liability whether in an action of contract tort or otherwise arising from
+out of or in connection with the software or the use or other dealings in
+the software`,
+
+	"Apache-2.0": `licensed under the apache license version 2 0 the license
+you may not use this file except in compliance with the license
+you may obtain a copy of the license at
+http www apache org licenses license 2 0
+unless required by applicable law or agreed to in writing software
+distributed under the license is distributed on an as is basis
+without warranties or conditions of any kind either express or implied
+see the license for the specific language governing permissions and
+limitations under the license`,
+
+	"BSD-3-Clause": `redistribution and use in source and binary forms with or without
+modification are permitted provided that the following conditions are met
+redistributions of source code must retain the above copyright notice this
+list of conditions and the following disclaimer
+redistributions in binary form must reproduce the above copyright notice
+this list of conditions and the following disclaimer in the documentation
+and or other materials provided with the distribution
+neither the name of the copyright holder nor the names of its contributors
+may be used to endorse or promote products derived from this software
+without specific prior written permission
+this software is provided by the copyright holders and contributors as is
+and any express or implied warranties including but not limited to the
+implied warranties of merchantability and fitness for a particular purpose
+are disclaimed`,
+
+	"ISC": `permission to use copy modify and or distribute this software for any
+purpose with or without fee is hereby granted provided that the above
+copyright notice and this permission notice appear in all copies
+the software is provided as is and the author disclaims all warranties
+with regard to this software including all implied warranties of
+merchantability and fitness in no event shall the author be liable for
+any special direct indirect or consequential damages or any damages
+whatsoever resulting from loss of use data or profits whether in an
+action of contract negligence or other tortious action arising out of or
+in connection with the use or performance of this software`,
+
+	"GPL-3.0": `this program is free software you can redistribute it and or modify
+it under the terms of the gnu general public license as published by
+the free software foundation either version 3 of the license or
+any later version this program is distributed in the hope that it will
+be useful but without any warranty without even the implied warranty of
+merchantability or fitness for a particular purpose see the gnu general
+public license for more details you should have received a copy of the
+gnu general public license along with this program`,
+}
+
+var (
+	commentMarkers = regexp.MustCompile(`(?m)^\s*(//|#|\*|/\*|--)+\s?`)
+	nonWord        = regexp.MustCompile(`[^a-z0-9\s]+`)
+	whitespace     = regexp.MustCompile(`\s+`)
+)
+
+func normalize(text string) string {
+	text = strings.ToLower(text)
+	text = commentMarkers.ReplaceAllString(text, "")
+	text = nonWord.ReplaceAllString(text, " ")
+	text = whitespace.ReplaceAllString(text, " ")
+	return strings.TrimSpace(text)
+}
+
+func tokenSet(text string) map[string]bool {
+	set := make(map[string]bool)
+	for _, tok := range strings.Fields(text) {
+		set[tok] = true
+	}
+	return set
+}
+
+// jaccard returns |a ∩ b| / |a ∪ b|.
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+
+	intersection := 0
+	for tok := range a {
+		if b[tok] {
+			intersection++
+		}
+	}
+
+	union := len(a) + len(b) - intersection
+	if union == 0 {
+		return 0
+	}
+	return float64(intersection) / float64(union)
+}
+
+// Match is the result of identifying candidate against the template
+// table: the best-scoring SPDX identifier (or Unknown) and how
+// confident that match is.
+type Match struct {
+	SPDXId     string
+	Confidence float64
+}
+
+// Identify normalizes candidate and scores it, via token-set Jaccard
+// similarity, against every template in the vendored table, returning
+// the best match. If nothing clears Threshold, SPDXId is Unknown.
+func Identify(candidate string) Match {
+	candidateTokens := tokenSet(normalize(candidate))
+
+	best := Match{SPDXId: Unknown}
+	for spdxId, template := range templates {
+		score := jaccard(candidateTokens, tokenSet(template))
+		if score > best.Confidence {
+			best = Match{SPDXId: spdxId, Confidence: score}
+		}
+	}
+
+	if best.Confidence < Threshold {
+		return Match{SPDXId: Unknown, Confidence: best.Confidence}
+	}
+	return best
+}
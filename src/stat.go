@@ -16,29 +16,75 @@ package drive
 
 import (
 	"fmt"
+	"io/ioutil"
 	"path/filepath"
+	"regexp"
 	"strings"
 
+	"github.com/odeke-em/drive/src/license"
 	"github.com/odeke-em/log"
 	drive "google.golang.org/api/drive/v2"
 )
 
+// licenseCandidatePattern matches the conventional names for files that
+// carry a project's license text.
+var licenseCandidatePattern = regexp.MustCompile(`(?i)^(LICENSE|COPYING|NOTICE|README)`)
+
+func isLicenseCandidate(name string) bool {
+	return licenseCandidatePattern.MatchString(name)
+}
+
 type keyValue struct {
 	key   string
 	value interface{}
 }
 
 func (g *Commands) StatById() error {
-	return g.statfn("statById", g.rem.FindById)
+	return g.statfn("statById", g.rem.FindById, false)
 }
 
 func (g *Commands) Stat() error {
-	return g.statfn("stat", g.rem.FindByPath)
+	return g.statfn("stat", g.rem.FindByPath, true)
 }
 
-func (g *Commands) statfn(fname string, fn func(string) (*File, error)) error {
-	var err error
+// statState carries the bits of state that used to live in package-level
+// globals (like the old `firstLine`) but need to be scoped to a single
+// statfn invocation instead, so that concurrent `stat` calls -- e.g. from
+// callers driving several sources at once -- don't race over shared
+// mutable state. The formatter itself now owns any further per-invocation
+// state (e.g. csvFormatter's header-printed flag).
+type statState struct {
+	formatter StatFormatter
+}
+
+func newStatState(g *Commands) (*statState, error) {
+	formatter, err := newStatFormatter(g)
+	if err != nil {
+		return nil, err
+	}
+	return &statState{formatter: formatter}, nil
+}
+
+// statfn drives fname's lookup (FindByPath for stat, FindById for
+// statById) over every configured source. globAware is set for path-based
+// sources only -- ids can't meaningfully contain glob metacharacters --
+// and lets a source like "projects/**/*.go" expand into many Files
+// instead of a single literal lookup.
+func (g *Commands) statfn(fname string, fn func(string) (*File, error), globAware bool) error {
+	state, err := newStatState(g)
+	if err != nil {
+		return err
+	}
+	defer state.formatter.Flush()
+
 	for _, src := range g.opts.Sources {
+		if globAware && isGlobPattern(src) {
+			if fErr := g.statGlobSource(fname, src, state); fErr != nil {
+				err = reComposeError(err, fErr.Error())
+			}
+			continue
+		}
+
 		f, fErr := fn(src)
 		if fErr != nil {
 			msg := fmt.Sprintf("%s: %s err: %v\n", fname, src, fErr)
@@ -56,7 +102,7 @@ func (g *Commands) statfn(fname string, fn func(string) (*File, error)) error {
 			}
 		}
 
-		if fErr = g.stat(src, f, g.opts.Depth); fErr != nil {
+		if fErr = g.stat(src, f, g.opts.Depth, state); fErr != nil {
 			msg := fmt.Sprintf("%s: %s err: %v\n", fname, src, fErr)
 			err = reComposeError(err, msg)
 			err = copyErrStatusCode(err, fErr)
@@ -93,93 +139,106 @@ func prettyFilePermission(logf log.Loggerf, perm *drive.Permission, file *File)
 	}
 	logf("%-60v,%-10v,%-25v,%-25v\t\t", file.Name, dirType, perm.Name, perm.EmailAddress)
 	for _, kv := range kvList {
-		logf(",%-25v", kv.value.(string)) 
+		logf(",%-25v", kv.value.(string))
 	}
 	logf("\n")
 }
 
-func prettyFileStat(logf log.Loggerf, relToRootPath string, file *File) {
-	dirType := "file"
-	if file.IsDir {
-		dirType = "folder"
+// detectLicense downloads target's content and identifies its license.
+// The second return value is false if the content could not be
+// retrieved at all, as distinct from a successful identification that
+// came back license.Unknown.
+func (g *Commands) detectLicense(target *File) (license.Match, bool) {
+	body, err := g.rem.Download(target.Id, "")
+	if err != nil {
+		return license.Match{}, false
 	}
+	defer body.Close()
 
-	logf("\n\033[92m%s\033[00m\n", relToRootPath)
-
-	kvList := []*keyValue{
-		&keyValue{"Filename", file.Name},
-		&keyValue{"FileId", file.Id},
-		&keyValue{"Bytes", fmt.Sprintf("%v", file.Size)},
-		&keyValue{"Size", prettyBytes(file.Size)},
-		&keyValue{"QuotaBytesUsed", fmt.Sprintf("%v", file.QuotaBytesUsed)},
-		&keyValue{"DirType", dirType},
-		&keyValue{"VersionNumber", fmt.Sprintf("%v", file.Version)},
-		&keyValue{"MimeType", file.MimeType},
-		&keyValue{"Etag", file.Etag},
-		&keyValue{"ModTime", fmt.Sprintf("%v", file.ModTime)},
-		&keyValue{"LastViewedByMe", fmt.Sprintf("%v", file.LastViewedByMeTime)},
-		&keyValue{"Shared", fmt.Sprintf("%v", file.Shared)},
-		&keyValue{"Owners", sepJoin(" & ", file.OwnerNames...)},
-		&keyValue{"LastModifyingUsername", file.LastModifyingUsername},
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		return license.Match{}, false
 	}
 
-	if file.Description != "" {
-		kvList = append(kvList, &keyValue{"Description", fmt.Sprintf("%q", file.Description)})
-	}
+	return license.Identify(string(content)), true
+}
+
+// findLicenseChild scans parentId's immediate children for the first
+// one matching isLicenseCandidate. It is only reached when
+// --detect-license is passed against a directory, so the extra
+// FindByParentId call it costs is opt-in.
+func (g *Commands) findLicenseChild(parentId string) (*File, bool) {
+	pagePair := g.rem.FindByParentId(parentId, g.opts.Hidden)
+	errsChan := pagePair.errsChan
+	childrenChan := pagePair.filesChan
 
-	if file.Name != file.OriginalFilename {
-		kvList = append(kvList, &keyValue{"OriginalFilename", file.OriginalFilename})
+	var found *File
+	working := true
+	for working {
+		select {
+		case err := <-errsChan:
+			if err != nil {
+				working = false
+			}
+		case child, stillHasContent := <-childrenChan:
+			if !stillHasContent {
+				working = false
+				break
+			}
+			if found == nil && !child.IsDir && isLicenseCandidate(child.Name) {
+				found = child
+			}
+		}
 	}
 
-	if !file.IsDir {
-		kvList = append(kvList, &keyValue{"Md5Checksum", file.Md5Checksum})
+	return found, found != nil
+}
 
-		// By default, folders are non-copyable, but drive implements recursively copying folders
-		kvList = append(kvList, &keyValue{"Copyable", fmt.Sprintf("%v", file.Copyable)})
+// resolveLicense implements the --detect-license behavior. Both a
+// direct hit on a LICENSE/COPYING/NOTICE/README-named file and finding
+// one among a directory's children require g.opts.DetectLicense: either
+// path downloads and fully buffers the candidate's content, so neither
+// should happen on a plain `drive stat`/`stat -r` without the caller
+// opting in.
+func (g *Commands) resolveLicense(file *File) (license.Match, bool) {
+	if !g.opts.DetectLicense {
+		return license.Match{}, false
 	}
 
-	if file.Labels != nil {
-		kvList = append(kvList,
-			&keyValue{"Starred", fmt.Sprintf("%v", file.Labels.Starred)},
-			&keyValue{"Viewed", fmt.Sprintf("%v", file.Labels.Viewed)},
-			&keyValue{"Trashed", fmt.Sprintf("%v", file.Labels.Trashed)},
-			&keyValue{"ViewersCanDownload", fmt.Sprintf("%v", file.Labels.Restricted)},
-		)
+	if !file.IsDir && isLicenseCandidate(file.Name) {
+		return g.detectLicense(file)
 	}
 
-	for _, kv := range kvList {
-		logf("%-25s %-30v\n", kv.key, kv.value.(string))
+	if file.IsDir {
+		if child, ok := g.findLicenseChild(file.Id); ok {
+			return g.detectLicense(child)
+		}
 	}
+
+	return license.Match{}, false
 }
-	
-var firstLine = true
 
-func (g *Commands) stat(relToRootPath string, file *File, depth int) error {
+func (g *Commands) stat(relToRootPath string, file *File, depth int, state *statState) error {
 	if g.opts.Md5sum {
 		if file.Md5Checksum != "" {
 			g.log.Logf("%32s  %s\n", file.Md5Checksum, strings.TrimPrefix(relToRootPath, "/"))
 		}
 	} else {
 		perms, permErr := g.rem.listPermissions(file.Id)
-		if g.opts.CsvOutput {
-			if firstLine {
-				g.log.Logf("File Name, Type, Name, Email, Role, AccountType\n")
-				firstLine = false
-			}
-			for _, perm := range perms {
-				prettyFilePermission(g.log.Logf, perm, file)
-			}
-		} else {
-			prettyFileStat(g.log.Logf, relToRootPath, file)
-			if permErr != nil {
-				return permErr
-			}
+		licenseMatch, licenseFound := g.resolveLicense(file)
 
-			for _, perm := range perms {
-				prettyPermission(g.log.Logf, perm)
-			}
+		entry := &StatEntry{File: file, RelPath: relToRootPath}
+		if licenseFound {
+			entry.License = licenseMatch.SPDXId
+			entry.LicenseConfidence = licenseMatch.Confidence
 		}
 
+		if fmtErr := state.formatter.File(entry, perms); fmtErr != nil {
+			return fmtErr
+		}
+		if permErr != nil {
+			return permErr
+		}
 	}
 
 	if depth == 0 {
@@ -221,7 +280,7 @@ func (g *Commands) stat(relToRootPath string, file *File, depth int) error {
 	}
 
 	for _, child := range remoteChildren {
-		g.stat(filepath.Clean(relToRootPath+"/"+child.Name), child, depth)
+		g.stat(filepath.Clean(relToRootPath+"/"+child.Name), child, depth, state)
 	}
 
 	return nil
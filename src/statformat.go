@@ -0,0 +1,336 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/odeke-em/log"
+	drive "google.golang.org/api/drive/v2"
+)
+
+// StatEntry bundles a remote File with the bits of context stat computes
+// about it that don't live on File itself: the path it was reached by
+// (relative to the stat root) and any license identified for it.
+type StatEntry struct {
+	*File
+	RelPath           string
+	License           string
+	LicenseConfidence float64
+}
+
+// StatFormatter turns a stream of stat results into output. stat calls
+// File once per visited entry, in walk order, then Flush once the walk
+// completes; formatters that write their output as each File call
+// comes in (the built-ins) can make Flush a no-op.
+type StatFormatter interface {
+	File(entry *StatEntry, perms []*drive.Permission) error
+	Flush() error
+}
+
+// newStatFormatter picks a formatter from g.opts: --format wins over
+// CSV output, which wins over JSON/NDJSON output, falling back to the
+// original human-readable format.
+func newStatFormatter(g *Commands) (StatFormatter, error) {
+	switch {
+	case g.opts.Format != "":
+		return newTemplateFormatter(g.log.Logf, g.opts.Format)
+	case g.opts.CsvOutput:
+		return &csvFormatter{logf: g.log.Logf}, nil
+	case g.opts.JsonOutput || g.opts.JsonlOutput:
+		return &jsonFormatter{logf: g.log.Logf, ndjson: g.opts.JsonlOutput}, nil
+	default:
+		return &humanFormatter{logf: g.log.Logf}, nil
+	}
+}
+
+// humanFormatter reproduces the original prettyFileStat/prettyPermission
+// output.
+type humanFormatter struct {
+	logf log.Loggerf
+}
+
+func (f *humanFormatter) File(entry *StatEntry, perms []*drive.Permission) error {
+	file := entry.File
+	dirType := "file"
+	if file.IsDir {
+		dirType = "folder"
+	}
+
+	f.logf("\n\033[92m%s\033[00m\n", entry.RelPath)
+
+	kvList := []*keyValue{
+		&keyValue{"Filename", file.Name},
+		&keyValue{"FileId", file.Id},
+		&keyValue{"Bytes", fmt.Sprintf("%v", file.Size)},
+		&keyValue{"Size", prettyBytes(file.Size)},
+		&keyValue{"QuotaBytesUsed", fmt.Sprintf("%v", file.QuotaBytesUsed)},
+		&keyValue{"DirType", dirType},
+		&keyValue{"VersionNumber", fmt.Sprintf("%v", file.Version)},
+		&keyValue{"MimeType", file.MimeType},
+		&keyValue{"Etag", file.Etag},
+		&keyValue{"ModTime", fmt.Sprintf("%v", file.ModTime)},
+		&keyValue{"LastViewedByMe", fmt.Sprintf("%v", file.LastViewedByMeTime)},
+		&keyValue{"Shared", fmt.Sprintf("%v", file.Shared)},
+		&keyValue{"Owners", sepJoin(" & ", file.OwnerNames...)},
+		&keyValue{"LastModifyingUsername", file.LastModifyingUsername},
+	}
+
+	if file.Description != "" {
+		kvList = append(kvList, &keyValue{"Description", fmt.Sprintf("%q", file.Description)})
+	}
+
+	if file.Name != file.OriginalFilename {
+		kvList = append(kvList, &keyValue{"OriginalFilename", file.OriginalFilename})
+	}
+
+	if !file.IsDir {
+		kvList = append(kvList, &keyValue{"Md5Checksum", file.Md5Checksum})
+
+		// By default, folders are non-copyable, but drive implements recursively copying folders
+		kvList = append(kvList, &keyValue{"Copyable", fmt.Sprintf("%v", file.Copyable)})
+	}
+
+	if file.Labels != nil {
+		kvList = append(kvList,
+			&keyValue{"Starred", fmt.Sprintf("%v", file.Labels.Starred)},
+			&keyValue{"Viewed", fmt.Sprintf("%v", file.Labels.Viewed)},
+			&keyValue{"Trashed", fmt.Sprintf("%v", file.Labels.Trashed)},
+			&keyValue{"ViewersCanDownload", fmt.Sprintf("%v", file.Labels.Restricted)},
+		)
+	}
+
+	if entry.License != "" {
+		kvList = append(kvList,
+			&keyValue{"License", entry.License},
+			&keyValue{"LicenseConfidence", fmt.Sprintf("%.2f", entry.LicenseConfidence)},
+		)
+	}
+
+	for _, kv := range kvList {
+		f.logf("%-25s %-30v\n", kv.key, kv.value.(string))
+	}
+
+	for _, perm := range perms {
+		prettyPermission(f.logf, perm)
+	}
+
+	return nil
+}
+
+func (f *humanFormatter) Flush() error { return nil }
+
+// csvFormatter reproduces the original prettyFilePermission CSV output.
+// firstLine used to be a package-level global; it is now scoped to a
+// single formatter instance, and so to a single stat/statById
+// invocation, so concurrent stat calls no longer race over it.
+type csvFormatter struct {
+	logf          log.Loggerf
+	headerPrinted bool
+}
+
+func (f *csvFormatter) File(entry *StatEntry, perms []*drive.Permission) error {
+	if !f.headerPrinted {
+		f.headerPrinted = true
+		f.logf("File Name, Type, Name, Email, Role, AccountType\n")
+	}
+
+	for _, perm := range perms {
+		prettyFilePermission(f.logf, perm, entry.File)
+	}
+
+	return nil
+}
+
+func (f *csvFormatter) Flush() error { return nil }
+
+type permissionJSON struct {
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	Role        string `json:"role"`
+	AccountType string `json:"accountType"`
+}
+
+type fileStatJSON struct {
+	Path                   string           `json:"path"`
+	Filename               string           `json:"filename"`
+	FileId                 string           `json:"fileId"`
+	Bytes                  int64            `json:"bytes"`
+	Size                   string           `json:"size"`
+	QuotaBytesUsed         int64            `json:"quotaBytesUsed"`
+	DirType                string           `json:"dirType"`
+	VersionNumber          int64            `json:"versionNumber"`
+	MimeType               string           `json:"mimeType"`
+	Etag                   string           `json:"etag"`
+	ModTime                string           `json:"modTime"`
+	LastViewedByMe         string           `json:"lastViewedByMe"`
+	Shared                 bool             `json:"shared"`
+	Owners                 []string         `json:"owners"`
+	LastModifyingUsername  string           `json:"lastModifyingUsername"`
+	Description            string           `json:"description,omitempty"`
+	OriginalFilename       string           `json:"originalFilename,omitempty"`
+	Md5Checksum            string           `json:"md5Checksum,omitempty"`
+	Copyable               *bool            `json:"copyable,omitempty"`
+	Starred                *bool            `json:"starred,omitempty"`
+	Viewed                 *bool            `json:"viewed,omitempty"`
+	Trashed                *bool            `json:"trashed,omitempty"`
+	ViewersCanDownload     *bool            `json:"viewersCanDownload,omitempty"`
+	License                string           `json:"license,omitempty"`
+	LicenseConfidence      float64          `json:"licenseConfidence,omitempty"`
+	Permissions            []permissionJSON `json:"permissions,omitempty"`
+}
+
+func toFileStatJSON(entry *StatEntry, perms []*drive.Permission) *fileStatJSON {
+	file := entry.File
+	dirType := "file"
+	if file.IsDir {
+		dirType = "folder"
+	}
+
+	fj := &fileStatJSON{
+		Path:                  entry.RelPath,
+		Filename:              file.Name,
+		FileId:                file.Id,
+		Bytes:                 file.Size,
+		Size:                  prettyBytes(file.Size),
+		QuotaBytesUsed:        file.QuotaBytesUsed,
+		DirType:               dirType,
+		VersionNumber:         file.Version,
+		MimeType:              file.MimeType,
+		Etag:                  file.Etag,
+		ModTime:               fmt.Sprintf("%v", file.ModTime),
+		LastViewedByMe:        fmt.Sprintf("%v", file.LastViewedByMeTime),
+		Shared:                file.Shared,
+		Owners:                file.OwnerNames,
+		LastModifyingUsername: file.LastModifyingUsername,
+		Description:           file.Description,
+		License:               entry.License,
+		LicenseConfidence:     entry.LicenseConfidence,
+	}
+
+	if file.Name != file.OriginalFilename {
+		fj.OriginalFilename = file.OriginalFilename
+	}
+
+	if !file.IsDir {
+		fj.Md5Checksum = file.Md5Checksum
+		copyable := file.Copyable
+		fj.Copyable = &copyable
+	}
+
+	if file.Labels != nil {
+		starred, viewed, trashed, restricted := file.Labels.Starred, file.Labels.Viewed, file.Labels.Trashed, file.Labels.Restricted
+		fj.Starred, fj.Viewed, fj.Trashed, fj.ViewersCanDownload = &starred, &viewed, &trashed, &restricted
+	}
+
+	for _, perm := range perms {
+		fj.Permissions = append(fj.Permissions, permissionJSON{
+			Name: perm.Name, Email: perm.EmailAddress, Role: perm.Role, AccountType: perm.Type,
+		})
+	}
+
+	return fj
+}
+
+// jsonFormatter emits one fileStatJSON object per File call: indented
+// when ndjson is false, one compact line when it is true (so the output
+// can be piped into jq/sqlite/log shippers a line at a time).
+type jsonFormatter struct {
+	logf   log.Loggerf
+	ndjson bool
+}
+
+func (f *jsonFormatter) File(entry *StatEntry, perms []*drive.Permission) error {
+	fj := toFileStatJSON(entry, perms)
+
+	var b []byte
+	var err error
+	if f.ndjson {
+		b, err = json.Marshal(fj)
+	} else {
+		b, err = json.MarshalIndent(fj, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+
+	f.logf("%s\n", b)
+	return nil
+}
+
+func (f *jsonFormatter) Flush() error { return nil }
+
+// logfWriter adapts a log.Loggerf into an io.Writer so text/template can
+// execute directly against it.
+type logfWriter struct {
+	logf log.Loggerf
+}
+
+func (w logfWriter) Write(p []byte) (int, error) {
+	w.logf("%s", string(p))
+	return len(p), nil
+}
+
+// templateContext is what a --format template is executed against: the
+// StatEntry's fields (via embedding, so .Name, .Md5Checksum, .RelPath,
+// .License, etc. are all in scope) plus the file's permissions.
+type templateContext struct {
+	*StatEntry
+	Permissions []*drive.Permission
+}
+
+// templateFormatter renders each file through a user-supplied
+// text/template, selected via --format='{{.Name}}\t{{.Md5Checksum}}' or,
+// for anything long enough to want its own file, --format=@/path/to/tmpl.
+type templateFormatter struct {
+	w    logfWriter
+	tmpl *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"prettyBytes": prettyBytes,
+}
+
+func newTemplateFormatter(logf log.Loggerf, format string) (*templateFormatter, error) {
+	body := format
+	if strings.HasPrefix(format, "@") {
+		content, err := ioutil.ReadFile(strings.TrimPrefix(format, "@"))
+		if err != nil {
+			return nil, err
+		}
+		body = string(content)
+	}
+
+	tmpl, err := template.New("stat-format").Funcs(templateFuncs).Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &templateFormatter{w: logfWriter{logf}, tmpl: tmpl}, nil
+}
+
+func (f *templateFormatter) File(entry *StatEntry, perms []*drive.Permission) error {
+	if err := f.tmpl.Execute(f.w, &templateContext{StatEntry: entry, Permissions: perms}); err != nil {
+		return err
+	}
+	_, err := f.w.Write([]byte("\n"))
+	return err
+}
+
+func (f *templateFormatter) Flush() error { return nil }
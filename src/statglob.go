@@ -0,0 +1,187 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// globMatch pairs a resolved path with the remote File it names.
+type globMatch struct {
+	path string
+	file *File
+}
+
+// globMetaChars are the characters that mark a source as a pattern
+// rather than a literal path, so plain `drive stat foo/bar` keeps
+// making a single FindByPath call instead of paying for a tree walk.
+const globMetaChars = "*?["
+
+func isGlobPattern(src string) bool {
+	return strings.ContainsAny(src, globMetaChars)
+}
+
+// listDirChildren drains a FindByParentId page pair into a slice. It is
+// the same call stat already makes to recurse, so glob expansion honors
+// .gdignore and --hidden exactly as a plain recursive stat does.
+func (g *Commands) listDirChildren(parentId string) ([]*File, error) {
+	var children []*File
+
+	pagePair := g.rem.FindByParentId(parentId, g.opts.Hidden)
+	errsChan := pagePair.errsChan
+	childrenChan := pagePair.filesChan
+
+	working := true
+	for working {
+		select {
+		case err := <-errsChan:
+			if err != nil {
+				return nil, err
+			}
+		case child, stillHasContent := <-childrenChan:
+			if !stillHasContent {
+				working = false
+				break
+			}
+			children = append(children, child)
+		}
+	}
+
+	return children, nil
+}
+
+// walkGlob descends the remote tree rooted at parent, matching segments
+// one path component at a time. A "**" segment matches zero or more
+// path components, so it is handled by trying the rest of the pattern
+// at the current node as well as recursing into every child without
+// consuming it.
+func (g *Commands) walkGlob(parent *File, parentPath string, segments []string, out chan<- globMatch) error {
+	if len(segments) == 0 {
+		out <- globMatch{path: parentPath, file: parent}
+		return nil
+	}
+
+	head, rest := segments[0], segments[1:]
+
+	if head == "**" {
+		if err := g.walkGlob(parent, parentPath, rest, out); err != nil {
+			return err
+		}
+
+		if !parent.IsDir {
+			return nil
+		}
+
+		children, err := g.listDirChildren(parent.Id)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			childPath := filepath.Clean(parentPath + "/" + child.Name)
+			if err := g.walkGlob(child, childPath, segments, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !parent.IsDir {
+		return nil
+	}
+
+	children, err := g.listDirChildren(parent.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		ok, err := filepath.Match(head, child.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		childPath := filepath.Clean(parentPath + "/" + child.Name)
+		if err := g.walkGlob(child, childPath, rest, out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expandGlob resolves pattern (e.g. "projects/**/*.go") into every
+// matching remote File, streaming (path, *File) pairs as they're found
+// rather than buffering the whole match set, so a caller driving
+// g.stat off of it can start printing/hashing before the walk finishes.
+func (g *Commands) expandGlob(pattern string) (<-chan globMatch, <-chan error) {
+	out := make(chan globMatch)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errc)
+
+		root, err := g.rem.FindByPath("/")
+		if err != nil {
+			errc <- err
+			return
+		}
+
+		segments := strings.Split(strings.Trim(pattern, "/"), "/")
+		if err := g.walkGlob(root, "", segments, out); err != nil {
+			errc <- err
+		}
+	}()
+
+	return out, errc
+}
+
+// statGlobSource expands pattern and drives g.stat from the resulting
+// match channel, the same way statfn drives it from a single
+// FindByPath/FindById lookup.
+func (g *Commands) statGlobSource(fname, pattern string, state *statState) error {
+	matches, errc := g.expandGlob(pattern)
+
+	var err error
+	for m := range matches {
+		// Unlike statfn's literal-path branch, m.path is already the
+		// glob-resolved path (e.g. "/projects/sub/a.go"), not an id or the
+		// raw pattern -- it must not be overwritten with the bare
+		// basename, or two matches with the same filename in different
+		// directories would print indistinguishable md5 lines.
+		src := m.path
+		if g.opts.Md5sum && m.file.IsDir && rootLike(src) {
+			src = ""
+		}
+
+		if sErr := g.stat(src, m.file, g.opts.Depth, state); sErr != nil {
+			msg := fmt.Sprintf("%s: %s err: %v\n", fname, src, sErr)
+			err = reComposeError(err, msg)
+			err = copyErrStatusCode(err, sErr)
+		}
+	}
+
+	if gErr := <-errc; gErr != nil {
+		msg := fmt.Sprintf("%s: %s err: %v\n", fname, pattern, gErr)
+		err = reComposeError(err, msg)
+	}
+
+	return err
+}